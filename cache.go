@@ -0,0 +1,275 @@
+package pkghtml
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// touch marks name as most recently used. h.mu must be held.
+func (h *handler) touch(name string) {
+	if h.maxPackages <= 0 && h.maxBytes <= 0 {
+		return
+	}
+	if el, ok := h.lruElems[name]; ok {
+		h.lru.MoveToFront(el)
+		return
+	}
+	h.lruElems[name] = h.lru.PushFront(name)
+}
+
+// evict removes the least recently used packages until the handler is
+// back within its configured MaxPackages and MaxBytes limits, canceling
+// the background updater for each evicted package. h.mu must be held.
+func (h *handler) evict() {
+	for h.overLimit() {
+		el := h.lru.Back()
+		if el == nil {
+			return
+		}
+		h.evictName(el.Value.(string))
+	}
+}
+
+func (h *handler) overLimit() bool {
+	if h.maxPackages > 0 && h.lru.Len() > h.maxPackages {
+		return true
+	}
+	if h.maxBytes > 0 && h.totalBytes > h.maxBytes {
+		return true
+	}
+	return false
+}
+
+// evictName removes every cached format of name and stops its updater.
+// h.mu must be held.
+func (h *handler) evictName(name string) {
+	if el, ok := h.lruElems[name]; ok {
+		h.lru.Remove(el)
+		delete(h.lruElems, name)
+	}
+	if cancel, ok := h.cancels[name]; ok {
+		cancel()
+		delete(h.cancels, name)
+	}
+	delete(h.updating, name)
+	for key := range h.packages {
+		if n, _, ok := splitCacheKey(key); ok && n == name {
+			h.totalBytes -= int64(len(h.packages[key].buf))
+			delete(h.packages, key)
+		}
+	}
+	if h.search != nil {
+		h.search.mu.Lock()
+		h.search.remove(name)
+		h.search.mu.Unlock()
+	}
+}
+
+// stats tracks cache hit/miss counters and per-package fetch outcomes
+// for the Debug endpoint.
+type stats struct {
+	mu      sync.Mutex
+	hits    int64
+	misses  int64
+	latency map[string]time.Duration
+	lastErr map[string]string
+}
+
+func newStats() *stats {
+	return &stats{
+		latency: make(map[string]time.Duration),
+		lastErr: make(map[string]string),
+	}
+}
+
+func (s *stats) hit() {
+	s.mu.Lock()
+	s.hits++
+	s.mu.Unlock()
+}
+
+func (s *stats) miss(name string, d time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.misses++
+	s.latency[name] = d
+	if err != nil {
+		s.lastErr[name] = err.Error()
+	} else {
+		delete(s.lastErr, name)
+	}
+}
+
+// statsSnapshot is the JSON representation served at "<prefix>/stats".
+type statsSnapshot struct {
+	CacheSize int64             `json:"cache_size"`
+	Hits      int64             `json:"hits"`
+	Misses    int64             `json:"misses"`
+	Latency   map[string]string `json:"latency"`
+	LastError map[string]string `json:"last_error,omitempty"`
+}
+
+// serveDebug dispatches requests under h.debugPrefix to the stats
+// endpoint or the pprof profiles.
+func (h *handler) serveDebug(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.URL.Path == h.debugPrefix+"/stats":
+		h.serveStats(w, req)
+	case strings.HasPrefix(req.URL.Path, h.debugPrefix+"/pprof/"):
+		h.servePprof(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (h *handler) serveStats(w http.ResponseWriter, req *http.Request) {
+	h.mu.Lock()
+	size := int64(len(h.packages))
+	h.mu.Unlock()
+	snap := statsSnapshot{CacheSize: size}
+	if h.stats != nil {
+		h.stats.mu.Lock()
+		snap.Hits = h.stats.hits
+		snap.Misses = h.stats.misses
+		snap.Latency = make(map[string]string, len(h.stats.latency))
+		for name, d := range h.stats.latency {
+			snap.Latency[name] = d.String()
+		}
+		if len(h.stats.lastErr) > 0 {
+			snap.LastError = make(map[string]string, len(h.stats.lastErr))
+			for name, msg := range h.stats.lastErr {
+				snap.LastError[name] = msg
+			}
+		}
+		h.stats.mu.Unlock()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snap)
+}
+
+// servePprof dispatches to a small reimplementation of the standard
+// net/http/pprof routes, built directly on runtime/pprof and
+// runtime/trace instead of importing net/http/pprof. That package's
+// init function unconditionally registers "/debug/pprof/..." on
+// http.DefaultServeMux the moment it is imported, which would leak
+// profiling endpoints into any process that also serves
+// http.DefaultServeMux elsewhere, regardless of whether Debug is used.
+func (h *handler) servePprof(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(req.URL.Path, h.debugPrefix+"/pprof/")
+	switch name {
+	case "":
+		servePprofIndex(w, req)
+	case "cmdline":
+		servePprofCmdline(w, req)
+	case "profile":
+		servePprofProfile(w, req)
+	case "symbol":
+		servePprofSymbol(w, req)
+	case "trace":
+		servePprofTrace(w, req)
+	default:
+		servePprofNamed(w, req, name)
+	}
+}
+
+// servePprofIndex lists every profile registered with runtime/pprof.
+func servePprofIndex(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, "<html>\n<body>\n")
+	for _, p := range pprof.Profiles() {
+		name := html.EscapeString(p.Name())
+		fmt.Fprintf(w, "<a href=\"%s?debug=1\">%s</a>: %d<br>\n", name, name, p.Count())
+	}
+	fmt.Fprint(w, "</body>\n</html>")
+}
+
+// servePprofNamed writes the named runtime/pprof profile, e.g.
+// "goroutine" or "heap", honoring the "debug" query parameter.
+func servePprofNamed(w http.ResponseWriter, req *http.Request, name string) {
+	p := pprof.Lookup(name)
+	if p == nil {
+		http.NotFound(w, req)
+		return
+	}
+	debug, _ := strconv.Atoi(req.URL.Query().Get("debug"))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	p.WriteTo(w, debug)
+}
+
+// servePprofCmdline writes the running program's command line, each
+// argument separated by a NUL byte, matching net/http/pprof.Cmdline.
+func servePprofCmdline(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, strings.Join(os.Args, "\x00"))
+}
+
+// servePprofProfile writes a CPU profile collected over the "seconds"
+// query parameter, defaulting to 30 seconds.
+func servePprofProfile(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+	if err := pprof.StartCPUProfile(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	time.Sleep(profileDuration(req, 30))
+	pprof.StopCPUProfile()
+}
+
+// servePprofTrace writes an execution trace collected over the
+// "seconds" query parameter, defaulting to 1 second.
+func servePprofTrace(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="trace"`)
+	if err := trace.Start(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	time.Sleep(profileDuration(req, 1))
+	trace.Stop()
+}
+
+func profileDuration(req *http.Request, fallbackSeconds int) time.Duration {
+	sec, err := strconv.Atoi(req.URL.Query().Get("seconds"))
+	if err != nil || sec <= 0 {
+		sec = fallbackSeconds
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// servePprofSymbol resolves newline- or space-separated hex program
+// counters, from the query string or request body, to function names
+// via runtime.FuncForPC, matching net/http/pprof.Symbol's protocol.
+func servePprofSymbol(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, "num_symbols: 1\n")
+	var body string
+	if req.Method == http.MethodPost {
+		b, _ := ioutil.ReadAll(req.Body)
+		body = string(b)
+	} else {
+		body = req.URL.RawQuery
+	}
+	for _, tok := range strings.Fields(strings.ReplaceAll(body, "+", " ")) {
+		addr, err := strconv.ParseUint(strings.TrimPrefix(tok, "0x"), 16, 64)
+		if err != nil {
+			continue
+		}
+		fn := runtime.FuncForPC(uintptr(addr))
+		if fn == nil {
+			continue
+		}
+		fmt.Fprintf(w, "%#x %s\n", addr, fn.Name())
+	}
+}
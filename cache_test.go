@@ -0,0 +1,158 @@
+package pkghtml
+
+import (
+	"container/list"
+	"context"
+	"testing"
+)
+
+// newTestHandler returns a handler with just enough state initialized
+// to exercise the cache bookkeeping in this file, without requiring
+// the real pkgdoc dependency.
+func newTestHandler() *handler {
+	return &handler{
+		packages: make(map[string]*pkg),
+		updating: make(map[string]bool),
+		cancels:  make(map[string]context.CancelFunc),
+		lru:      list.New(),
+		lruElems: make(map[string]*list.Element),
+	}
+}
+
+func TestEvictName(t *testing.T) {
+	h := newTestHandler()
+	canceled := false
+	h.lruElems["a"] = h.lru.PushFront("a")
+	h.cancels["a"] = func() { canceled = true }
+	h.updating["a"] = true
+	h.setPackage(cacheKey("a", "text/html"), &pkg{buf: []byte("aaa")})
+	h.setPackage(cacheKey("a", "application/json"), &pkg{buf: []byte("bb")})
+	h.setPackage(cacheKey("b", "text/html"), &pkg{buf: []byte("c")})
+
+	h.evictName("a")
+
+	if !canceled {
+		t.Error("evictName did not cancel the updater for the evicted name")
+	}
+	if _, ok := h.lruElems["a"]; ok {
+		t.Error("evictName left a stale LRU entry")
+	}
+	if h.updating["a"] {
+		t.Error("evictName left the updating flag set")
+	}
+	if _, ok := h.packages[cacheKey("a", "text/html")]; ok {
+		t.Error("evictName left a cached format behind")
+	}
+	if _, ok := h.packages[cacheKey("a", "application/json")]; ok {
+		t.Error("evictName left a cached format behind")
+	}
+	if _, ok := h.packages[cacheKey("b", "text/html")]; !ok {
+		t.Error("evictName removed an unrelated name")
+	}
+	if h.totalBytes != int64(len("c")) {
+		t.Errorf("totalBytes = %d, want %d", h.totalBytes, len("c"))
+	}
+}
+
+func TestEvictNameRemovesFromSearchIndex(t *testing.T) {
+	h := newTestHandler()
+	h.search = newSearchIndex()
+	h.lruElems["a"] = h.lru.PushFront("a")
+	h.search.text["a"] = "alpha"
+	h.search.terms["alpha"] = map[string]int{"a": 1, "b": 1}
+
+	h.evictName("a")
+
+	if _, ok := h.search.text["a"]; ok {
+		t.Error("evictName left an evicted name in the search index's text")
+	}
+	if _, ok := h.search.terms["alpha"]["a"]; ok {
+		t.Error("evictName left an evicted name in the search index's terms")
+	}
+	if _, ok := h.search.terms["alpha"]["b"]; !ok {
+		t.Error("evictName removed an unrelated name from the search index")
+	}
+}
+
+func TestEvictMaxPackages(t *testing.T) {
+	h := newTestHandler()
+	h.maxPackages = 2
+	for _, name := range []string{"a", "b", "c"} {
+		h.lruElems[name] = h.lru.PushFront(name)
+		h.setPackage(cacheKey(name, "text/html"), &pkg{buf: []byte(name)})
+	}
+
+	h.evict()
+
+	if h.lru.Len() != 2 {
+		t.Fatalf("lru.Len() = %d, want 2", h.lru.Len())
+	}
+	if _, ok := h.lruElems["a"]; ok {
+		t.Error("evict kept the least recently used name")
+	}
+	for _, name := range []string{"b", "c"} {
+		if _, ok := h.lruElems[name]; !ok {
+			t.Errorf("evict removed %q, which was still within the limit", name)
+		}
+	}
+}
+
+func TestEvictMaxBytes(t *testing.T) {
+	h := newTestHandler()
+	h.maxBytes = 3
+	for _, name := range []string{"a", "b"} {
+		h.lruElems[name] = h.lru.PushFront(name)
+		h.setPackage(cacheKey(name, "text/html"), &pkg{buf: []byte(name + name)})
+	}
+
+	h.evict()
+
+	if h.overLimit() {
+		t.Errorf("handler is still over its byte limit after evict: totalBytes=%d maxBytes=%d", h.totalBytes, h.maxBytes)
+	}
+}
+
+func TestWriteBack(t *testing.T) {
+	t.Run("canceled context does not resurrect an evicted package", func(t *testing.T) {
+		h := newTestHandler()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		wrote := h.writeBack(ctx, "a", "text/html", &pkg{buf: []byte("new")})
+
+		if wrote {
+			t.Error("writeBack reported a write for a canceled context")
+		}
+		if _, ok := h.packages[cacheKey("a", "text/html")]; ok {
+			t.Error("writeBack inserted a package for a canceled context")
+		}
+	})
+
+	t.Run("live context writes through", func(t *testing.T) {
+		h := newTestHandler()
+		ctx := context.Background()
+
+		wrote := h.writeBack(ctx, "a", "text/html", &pkg{buf: []byte("new")})
+
+		if !wrote {
+			t.Error("writeBack reported no write for a live context")
+		}
+		p, ok := h.packages[cacheKey("a", "text/html")]
+		if !ok || string(p.buf) != "new" {
+			t.Errorf("packages[key] = %v, want buf %q", p, "new")
+		}
+	})
+
+	t.Run("identical bytes are not rewritten", func(t *testing.T) {
+		h := newTestHandler()
+		ctx := context.Background()
+		key := cacheKey("a", "text/html")
+		h.setPackage(key, &pkg{buf: []byte("same")})
+
+		wrote := h.writeBack(ctx, "a", "text/html", &pkg{buf: []byte("same")})
+
+		if wrote {
+			t.Error("writeBack reported a write for unchanged bytes")
+		}
+	})
+}
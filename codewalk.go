@@ -0,0 +1,139 @@
+package pkghtml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pnelson/pkgdoc"
+)
+
+// codewalkPrefix is the path prefix a codewalk is mounted under, e.g.
+// /codewalk/<name>/.
+const codewalkPrefix = "/codewalk/"
+
+// codewalk represents a guided tour over an imported package's source:
+// an ordered sequence of steps, each pairing prose with an excerpt of
+// the source it describes.
+type codewalk struct {
+	Title string          `xml:"title,attr"`
+	Steps []*codewalkStep `xml:"step"`
+}
+
+// codewalkStep represents a single step of a codewalk.
+type codewalkStep struct {
+	Comment string `xml:"comment"`
+	File    string `xml:"src,attr"`
+	Lo      int    `xml:"lo,attr"`
+	Hi      int    `xml:"hi,attr"`
+}
+
+// parseCodewalk reads and parses the codewalk XML file at filename.
+func parseCodewalk(filename string) (*codewalk, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cw := new(codewalk)
+	if err := xml.Unmarshal(b, cw); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// scanCodewalkDirs parses every *.codewalk file in each directory
+// registered via CodewalkDir, mounting it under its base name.
+func scanCodewalkDirs(h *handler) {
+	for _, dir := range h.codewalkDirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range files {
+			if fi.IsDir() || filepath.Ext(fi.Name()) != ".codewalk" {
+				continue
+			}
+			name := strings.TrimSuffix(fi.Name(), filepath.Ext(fi.Name()))
+			cw, err := parseCodewalk(filepath.Join(dir, fi.Name()))
+			if err != nil {
+				continue
+			}
+			h.codewalks[name] = cw
+		}
+	}
+}
+
+// serveCodewalk renders a single step of the codewalk named by the
+// request path, with next/previous links driven by the "step" query
+// parameter.
+func (h *handler) serveCodewalk(w http.ResponseWriter, req *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(req.URL.Path, codewalkPrefix), "/")
+	cw, ok := h.codewalks[name]
+	if !ok || len(cw.Steps) == 0 {
+		http.NotFound(w, req)
+		return
+	}
+	step := 0
+	if v := req.URL.Query().Get("step"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < len(cw.Steps) {
+			step = n
+		}
+	}
+	s := cw.Steps[step]
+	src, err := h.readCodewalkSource(s.File)
+	if err != nil {
+		h.errorHandler(w, req, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>%s</title></head>\n<body>\n", html.EscapeString(cw.Title))
+	fmt.Fprintf(w, "<h1>%s</h1>\n", html.EscapeString(cw.Title))
+	fmt.Fprint(w, "<table><tr>\n<td valign=\"top\">\n")
+	fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(s.Comment))
+	fmt.Fprint(w, "</td>\n<td valign=\"top\">\n")
+	fmt.Fprintf(w, "<pre>%s</pre>\n", html.EscapeString(excerptLines(src, s.Lo, s.Hi)))
+	fmt.Fprint(w, "</td>\n</tr></table>\n")
+	fmt.Fprint(w, "<p>\n")
+	if step > 0 {
+		fmt.Fprintf(w, "<a href=\"?step=%d\">previous</a>\n", step-1)
+	}
+	if step < len(cw.Steps)-1 {
+		fmt.Fprintf(w, "<a href=\"?step=%d\">next</a>\n", step+1)
+	}
+	fmt.Fprint(w, "</p>\n</body>\n</html>")
+}
+
+// readCodewalkSource resolves file against the directory of the
+// handler's imported package and returns its contents.
+func (h *handler) readCodewalkSource(file string) ([]byte, error) {
+	doc, err := pkgdoc.New(h.name)
+	if doc.Name == "" {
+		err = ErrImport
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filepath.Join(doc.Dir, file))
+}
+
+// excerptLines returns the inclusive, 1-indexed line range [lo, hi] of
+// src, clamped to the bounds of the source. A hi less than lo selects
+// through the last line, and a lo past the end yields the empty string.
+func excerptLines(src []byte, lo, hi int) string {
+	lines := strings.Split(string(src), "\n")
+	if lo < 1 {
+		lo = 1
+	}
+	if lo > len(lines) {
+		return ""
+	}
+	if hi < lo || hi > len(lines) {
+		hi = len(lines)
+	}
+	return strings.Join(lines[lo-1:hi], "\n")
+}
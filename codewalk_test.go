@@ -0,0 +1,74 @@
+package pkghtml
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestExcerptLines(t *testing.T) {
+	src := []byte("one\ntwo\nthree\nfour\nfive")
+	tests := []struct {
+		name   string
+		lo, hi int
+		want   string
+	}{
+		{"full range", 1, 5, "one\ntwo\nthree\nfour\nfive"},
+		{"single line", 2, 2, "two"},
+		{"middle range", 2, 4, "two\nthree\nfour"},
+		{"lo clamped up from zero", 0, 2, "one\ntwo"},
+		{"lo clamped up from negative", -3, 1, "one"},
+		{"hi clamped down when past the end", 4, 100, "four\nfive"},
+		{"hi clamped when less than lo", 3, 1, "three\nfour\nfive"},
+		{"lo past the end of the source", 100, 100, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := excerptLines(src, tt.lo, tt.hi); got != tt.want {
+				t.Errorf("excerptLines(src, %d, %d) = %q, want %q", tt.lo, tt.hi, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCodewalk(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "example.codewalk")
+	xml := `<codewalk title="Example">
+<step src="foo.go" lo="1" hi="3">
+<comment>First step.</comment>
+</step>
+<step src="bar.go" lo="4" hi="9">
+<comment>Second step.</comment>
+</step>
+</codewalk>`
+	if err := ioutil.WriteFile(path, []byte(xml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cw, err := parseCodewalk(path)
+	if err != nil {
+		t.Fatalf("parseCodewalk() error = %v", err)
+	}
+	if cw.Title != "Example" {
+		t.Errorf("Title = %q, want %q", cw.Title, "Example")
+	}
+	if len(cw.Steps) != 2 {
+		t.Fatalf("len(Steps) = %d, want 2", len(cw.Steps))
+	}
+	want := []codewalkStep{
+		{Comment: "First step.", File: "foo.go", Lo: 1, Hi: 3},
+		{Comment: "Second step.", File: "bar.go", Lo: 4, Hi: 9},
+	}
+	for i, step := range cw.Steps {
+		if *step != want[i] {
+			t.Errorf("Steps[%d] = %+v, want %+v", i, *step, want[i])
+		}
+	}
+}
+
+func TestParseCodewalkMissingFile(t *testing.T) {
+	if _, err := parseCodewalk(filepath.Join(t.TempDir(), "missing.codewalk")); err == nil {
+		t.Error("parseCodewalk() error = nil, want an error for a missing file")
+	}
+}
@@ -0,0 +1,156 @@
+package pkghtml
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/pnelson/pkgdoc"
+)
+
+// LinkHook registers a function invoked for every external link found
+// in a rendered doc comment, letting callers rewrite external URLs, for
+// example to route outbound links through a redirector. It is not
+// invoked for intra-page identifier references; see IdentHook for
+// those. Unset by default, in which case links render unmodified.
+func LinkHook(fn func(target, text string) template.HTML) Option {
+	return func(h *handler) {
+		h.linkHook = fn
+	}
+}
+
+// IdentHook registers a function invoked for every intra-page
+// identifier reference found in a rendered doc comment, letting callers
+// rewrite cross-package identifier references into links across a
+// documentation site. Unset by default, in which case identifier
+// references render unmodified.
+func IdentHook(fn func(sym pkgdoc.Symbol) template.HTML) Option {
+	return func(h *handler) {
+		h.identHook = fn
+	}
+}
+
+// CodeHook registers a function invoked for every declaration the
+// default renderer would otherwise wrap in a bare <pre> block, letting
+// callers apply syntax highlighting. Unset by default, in which case
+// declarations render as escaped plain text.
+func CodeHook(fn func(src, lang string) template.HTML) Option {
+	return func(h *handler) {
+		h.codeHook = fn
+	}
+}
+
+// templateFuncs returns the function map the default renderer's
+// template, and any registered Layout, use to apply render hooks
+// without requiring callers to fork the template.
+func (h *handler) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"doc":  h.renderDoc,
+		"code": h.renderCode,
+	}
+}
+
+// renderDoc applies LinkHook and IdentHook to the anchors found in doc,
+// which pkgdoc has already rendered to HTML, by walking it with
+// golang.org/x/net/html.
+func (h *handler) renderDoc(doc template.HTML) template.HTML {
+	if h.linkHook == nil && h.identHook == nil {
+		return doc
+	}
+	nodes, err := html.ParseFragment(strings.NewReader(string(doc)), bodyContext())
+	if err != nil {
+		return doc
+	}
+	root := bodyContext()
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+	h.rewriteAnchors(root)
+	var buf bytes.Buffer
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&buf, c); err != nil {
+			return doc
+		}
+	}
+	return template.HTML(buf.String())
+}
+
+// renderCode applies CodeHook to decl, assumed to be Go source, falling
+// back to an escaped <pre> block when no hook is registered.
+func (h *handler) renderCode(decl string) template.HTML {
+	if h.codeHook == nil {
+		return template.HTML("<pre>" + template.HTMLEscapeString(decl) + "</pre>")
+	}
+	return template.HTML("<pre>") + h.codeHook(decl, "go") + template.HTML("</pre>")
+}
+
+// rewriteAnchors walks n's children, replacing <a> elements using
+// LinkHook or IdentHook depending on whether the link is a same-page
+// identifier reference or an external URL.
+func (h *handler) rewriteAnchors(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			h.rewriteAnchor(n, c)
+		} else {
+			h.rewriteAnchors(c)
+		}
+		c = next
+	}
+}
+
+// rewriteAnchor replaces a, a child of parent, with the hook-rendered
+// HTML for its target, leaving it unmodified if no hook applies.
+func (h *handler) rewriteAnchor(parent, a *html.Node) {
+	href := attr(a, "href")
+	var replacement template.HTML
+	switch {
+	case strings.HasPrefix(href, "#") && h.identHook != nil:
+		replacement = h.identHook(pkgdoc.Symbol{Name: strings.TrimPrefix(href, "#")})
+	case !strings.HasPrefix(href, "#") && h.linkHook != nil:
+		replacement = h.linkHook(href, textOf(a))
+	default:
+		return
+	}
+	frag, err := html.ParseFragment(strings.NewReader(string(replacement)), bodyContext())
+	if err != nil {
+		return
+	}
+	for _, n := range frag {
+		parent.InsertBefore(n, a)
+	}
+	parent.RemoveChild(a)
+}
+
+// bodyContext returns a context node suitable for parsing a HTML
+// fragment that may contain inline elements and bare text.
+func bodyContext() *html.Node {
+	return &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textOf(n *html.Node) string {
+	var buf bytes.Buffer
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return buf.String()
+}
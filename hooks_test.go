@@ -0,0 +1,77 @@
+package pkghtml
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+
+	"github.com/pnelson/pkgdoc"
+)
+
+func TestRenderDocNoHooksIsNoop(t *testing.T) {
+	h := &handler{}
+	in := template.HTML(`<p>see <a href="#Foo">Foo</a> or <a href="https://example.com">example</a></p>`)
+	if got := h.renderDoc(in); got != in {
+		t.Errorf("renderDoc() = %q, want unchanged %q", got, in)
+	}
+}
+
+func TestRenderDocAppliesIdentHook(t *testing.T) {
+	h := &handler{
+		identHook: func(sym pkgdoc.Symbol) template.HTML {
+			return template.HTML(`<a href="/sym/` + sym.Name + `">` + sym.Name + `</a>`)
+		},
+	}
+	got := h.renderDoc(template.HTML(`<a href="#Foo">Foo</a>`))
+	if !strings.Contains(string(got), `href="/sym/Foo"`) {
+		t.Errorf("renderDoc() = %q, want the identHook's rewritten href", got)
+	}
+}
+
+func TestRenderDocAppliesLinkHook(t *testing.T) {
+	h := &handler{
+		linkHook: func(target, text string) template.HTML {
+			return template.HTML(`<a href="/out?to=` + target + `">` + text + `</a>`)
+		},
+	}
+	got := h.renderDoc(template.HTML(`<a href="https://example.com">example</a>`))
+	if !strings.Contains(string(got), `/out?to=https://example.com`) {
+		t.Errorf("renderDoc() = %q, want the linkHook's rewritten href", got)
+	}
+}
+
+func TestRenderDocLeavesUnmatchedAnchorsAlone(t *testing.T) {
+	h := &handler{
+		identHook: func(sym pkgdoc.Symbol) template.HTML {
+			return template.HTML(`<a href="/sym/` + sym.Name + `">hit</a>`)
+		},
+	}
+	got := h.renderDoc(template.HTML(`<a href="https://example.com">example</a>`))
+	if !strings.Contains(string(got), `href="https://example.com"`) {
+		t.Errorf("renderDoc() = %q, want the external link left untouched since only identHook is set", got)
+	}
+}
+
+func TestRenderCode(t *testing.T) {
+	t.Run("no hook escapes and wraps in pre", func(t *testing.T) {
+		h := &handler{}
+		got := h.renderCode("func F() {}\n<script>")
+		want := template.HTML("<pre>" + template.HTMLEscapeString("func F() {}\n<script>") + "</pre>")
+		if got != want {
+			t.Errorf("renderCode() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("hook output is wrapped in pre unescaped", func(t *testing.T) {
+		h := &handler{
+			codeHook: func(src, lang string) template.HTML {
+				return template.HTML(`<span class="` + lang + `">` + src + `</span>`)
+			},
+		}
+		got := h.renderCode("func F() {}")
+		want := template.HTML(`<pre><span class="go">func F() {}</span></pre>`)
+		if got != want {
+			t.Errorf("renderCode() = %q, want %q", got, want)
+		}
+	})
+}
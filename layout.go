@@ -0,0 +1,66 @@
+package pkghtml
+
+import (
+	"html/template"
+	"io/ioutil"
+)
+
+// namedTemplate associates a name in the handler's template set with the
+// file it is parsed from.
+type namedTemplate struct {
+	name     string
+	filename string
+}
+
+// Layout registers a top-level layout template under name, parsed from
+// filename. The default renderer looks up the layout registered under
+// the name "layout" to use as its entry point, executing it against the
+// same data passed to the flat default template. Layouts can reference
+// blocks and partials registered via Block and Partial by name, e.g.
+// {{template "header" .}}. Every package is rendered with the same
+// template set; a block cannot be overridden for a single package.
+func Layout(name, filename string) Option {
+	return func(h *handler) {
+		h.layoutFiles = append(h.layoutFiles, namedTemplate{name: name, filename: filename})
+	}
+}
+
+// Block registers a named block template, parsed from filename, that a
+// layout or another block can invoke with {{template "name" .}}.
+func Block(name, filename string) Option {
+	return func(h *handler) {
+		h.blockFiles = append(h.blockFiles, namedTemplate{name: name, filename: filename})
+	}
+}
+
+// Partial registers a named partial template, parsed from filename,
+// available to layouts and blocks in the same way as Block.
+func Partial(name, filename string) Option {
+	return func(h *handler) {
+		h.partialFiles = append(h.partialFiles, namedTemplate{name: name, filename: filename})
+	}
+}
+
+// buildTemplateSet parses every layout, block, and partial registered on
+// h into a single *template.Template set so named templates can
+// reference one another. It returns nil if nothing was registered, in
+// which case the default renderer falls back to the flat h.template
+// string.
+func buildTemplateSet(h *handler) *template.Template {
+	if len(h.layoutFiles) == 0 && len(h.blockFiles) == 0 && len(h.partialFiles) == 0 {
+		return nil
+	}
+	set := template.New("pkghtml").Funcs(h.templateFuncs())
+	for _, files := range [][]namedTemplate{h.layoutFiles, h.blockFiles, h.partialFiles} {
+		for _, nt := range files {
+			b, err := ioutil.ReadFile(nt.filename)
+			if err != nil {
+				continue
+			}
+			if _, err := set.New(nt.name).Parse(string(b)); err != nil {
+				continue
+			}
+		}
+	}
+	return set
+}
@@ -0,0 +1,72 @@
+package pkghtml
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile(%q): %v", path, err)
+	}
+	return path
+}
+
+func TestBuildTemplateSetNilWhenNothingRegistered(t *testing.T) {
+	h := &handler{}
+	if set := buildTemplateSet(h); set != nil {
+		t.Errorf("buildTemplateSet() = %v, want nil", set)
+	}
+}
+
+func TestBuildTemplateSetParsesLayoutsBlocksAndPartials(t *testing.T) {
+	dir := t.TempDir()
+	layout := writeTestFile(t, dir, "layout.html", `{{template "header" .}}body{{template "footer" .}}`)
+	block := writeTestFile(t, dir, "header.html", `header`)
+	partial := writeTestFile(t, dir, "footer.html", `footer`)
+
+	h := &handler{
+		layoutFiles:  []namedTemplate{{name: "layout", filename: layout}},
+		blockFiles:   []namedTemplate{{name: "header", filename: block}},
+		partialFiles: []namedTemplate{{name: "footer", filename: partial}},
+	}
+
+	set := buildTemplateSet(h)
+	if set == nil {
+		t.Fatal("buildTemplateSet() = nil, want a populated set")
+	}
+	for _, name := range []string{"layout", "header", "footer"} {
+		if set.Lookup(name) == nil {
+			t.Errorf("set.Lookup(%q) = nil, want a parsed template", name)
+		}
+	}
+}
+
+func TestBuildTemplateSetSkipsUnreadableOrInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	valid := writeTestFile(t, dir, "layout.html", `ok`)
+	invalid := writeTestFile(t, dir, "bad.html", `{{define`)
+
+	h := &handler{
+		layoutFiles: []namedTemplate{
+			{name: "layout", filename: valid},
+			{name: "missing", filename: filepath.Join(dir, "does-not-exist.html")},
+			{name: "bad", filename: invalid},
+		},
+	}
+
+	set := buildTemplateSet(h)
+	if set == nil {
+		t.Fatal("buildTemplateSet() = nil, want a set with at least the valid template")
+	}
+	tmpl := set.Lookup("layout")
+	if tmpl == nil {
+		t.Fatal("a missing or invalid template caused the valid one to be dropped too")
+	}
+	if err := tmpl.Execute(ioutil.Discard, nil); err != nil {
+		t.Errorf("valid layout failed to execute: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package pkghtml
 import (
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/pnelson/pkgdoc"
@@ -11,17 +12,29 @@ import (
 // Option describes a functional option for configuring the file system.
 type Option func(*handler)
 
-// Render sets the package documentation rendering function.
-// Defaults to rendering a default template.
+// Render sets the package documentation rendering function used for the
+// "text/html" MIME type. Defaults to rendering a default template. This
+// is equivalent to calling Renderer("text/html", fn).
 func Render(fn func(doc pkgdoc.Package) ([]byte, error)) Option {
+	return Renderer(defaultMIME, fn)
+}
+
+// Renderer registers a rendering function for the given MIME type.
+// ServeHTTP performs content negotiation against the request's Accept
+// header and caches one rendered pkg per (name, mime) pair, falling
+// back to "text/html" when no registered renderer matches. This package
+// registers "application/json" and "text/markdown" renderers by
+// default; call Renderer with one of those MIME types to replace them.
+func Renderer(mime string, fn func(doc pkgdoc.Package) ([]byte, error)) Option {
 	return func(h *handler) {
-		h.render = fn
+		h.renderers[mime] = fn
 	}
 }
 
 // Template sets the package documentation template. The default renderer
 // applies this template to an instance of pkgdoc.Package. This option is
-// ignored if the Render option is used. Defaults to a simple HTML5 document.
+// ignored if the Render option is used, or if a Layout named "layout" is
+// registered. Defaults to a simple HTML5 document.
 func Template(filename string) Option {
 	return func(h *handler) {
 		b, err := ioutil.ReadFile(filename)
@@ -58,6 +71,78 @@ func UpdateDuration(d time.Duration) Option {
 	}
 }
 
+// Search enables full-text search over cached packages. It mounts a
+// /search route that tokenizes the "q" query parameter and returns
+// ranked results with highlighted snippets drawn from each package's
+// identifiers, synopsis, and doc paragraphs. Disabled by default.
+func Search() Option {
+	return func(h *handler) {
+		h.search = newSearchIndex()
+	}
+}
+
+// MaxPackages caps the number of distinct import paths kept in the
+// cache, evicting the least recently used package, across all of its
+// cached MIME types, once the limit is exceeded. Evicting a package
+// also cancels its background update goroutine. Zero, the default,
+// disables the cap.
+func MaxPackages(n int) Option {
+	return func(h *handler) {
+		h.maxPackages = n
+	}
+}
+
+// MaxBytes caps the total size, in bytes, of every cached rendered
+// format, evicting the least recently used package once the limit is
+// exceeded. Zero, the default, disables the cap.
+func MaxBytes(n int64) Option {
+	return func(h *handler) {
+		h.maxBytes = n
+	}
+}
+
+// Debug mounts a debug router under prefix: "<prefix>/stats" returns
+// cache size, hit/miss counters, per-package fetch latencies, and the
+// last fetch error as JSON, and "<prefix>/pprof/..." exposes the
+// standard net/http/pprof profiles for runtime introspection. Disabled
+// by default.
+func Debug(prefix string) Option {
+	return func(h *handler) {
+		h.debugPrefix = strings.TrimSuffix(prefix, "/")
+		h.stats = newStats()
+	}
+}
+
+// Codewalk registers a codewalk parsed from filename under name,
+// mounting it at /codewalk/<name>/. A codewalk is an ordered sequence
+// of steps, each pairing prose with an excerpt of the source it
+// describes, authored as a small XML schema:
+//
+//	<codewalk title="...">
+//	  <step src="file.go" lo="1" hi="10"><comment>...</comment></step>
+//	</codewalk>
+//
+// Visiting /codewalk/<name>/ renders the first step with next/previous
+// navigation driven by a "step" query parameter.
+func Codewalk(name, filename string) Option {
+	return func(h *handler) {
+		cw, err := parseCodewalk(filename)
+		if err != nil {
+			return
+		}
+		h.codewalks[name] = cw
+	}
+}
+
+// CodewalkDir registers every "*.codewalk" file found in dir, using
+// each file's base name, without extension, as its mount name under
+// /codewalk/<name>/.
+func CodewalkDir(dir string) Option {
+	return func(h *handler) {
+		h.codewalkDirs = append(h.codewalkDirs, dir)
+	}
+}
+
 // defaultStylesheet is the default stylesheet for the default renderer.
 const defaultStylesheet = ""
 
@@ -74,7 +159,7 @@ const defaultTemplate = `<!DOCTYPE html>
 <body>
 <h1>{{.Name}}</h1>
 <p>{{.ImportPath}}</p>
-{{.Doc.HTML}}
+{{doc .Doc.HTML}}
 
 <h2 id="index">Index</h2>
 <ul>
@@ -107,43 +192,43 @@ const defaultTemplate = `<!DOCTYPE html>
 {{- with .Constants -}}
 <h2 id="constants">Constants</h2>
 {{- range . -}}
-<pre>{{.Decl}}</pre>
-{{.Doc.HTML}}
+{{code .Decl}}
+{{doc .Doc.HTML}}
 {{- end -}}
 {{- end -}}
 
 {{- with .Variables -}}
 <h2 id="variables">Variables</h2>
 {{- range . -}}
-<pre>{{.Decl}}</pre>
-{{.Doc.HTML}}
+{{code .Decl}}
+{{doc .Doc.HTML}}
 {{- end -}}
 {{- end -}}
 
 {{- range .Functions -}}
 <h2 id="{{.Name}}">{{.Decl}}</h2>
-{{.Doc.HTML}}
+{{doc .Doc.HTML}}
 {{- end -}}
 
 {{- range $t := .Types -}}
 <h2 id="{{.Name}}">type {{.Name}}</h2>
-<pre>{{.Decl}}</pre>
-{{.Doc.HTML}}
+{{code .Decl}}
+{{doc .Doc.HTML}}
 {{- range .Constants -}}
-<pre>{{.Decl}}</pre>
-{{.Doc.HTML}}
+{{code .Decl}}
+{{doc .Doc.HTML}}
 {{- end -}}
 {{- range .Variables -}}
-<pre>{{.Decl}}</pre>
-{{.Doc.HTML}}
+{{code .Decl}}
+{{doc .Doc.HTML}}
 {{- end -}}
 {{- range .Functions -}}
 <h3 id="{{.Name}}">{{.Decl}}</h3>
-{{.Doc.HTML}}
+{{doc .Doc.HTML}}
 {{- end -}}
 {{- range .Methods -}}
 <h3 id="{{$t.Name}}.{{.Name}}">{{.Decl}}</h3>
-{{.Doc.HTML}}
+{{doc .Doc.HTML}}
 {{- end -}}
 {{- end -}}
 
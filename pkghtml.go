@@ -3,11 +3,18 @@ package pkghtml
 
 import (
 	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"html/template"
 	"io"
 	"net/http"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -15,22 +22,46 @@ import (
 	"github.com/pnelson/pkgdoc"
 )
 
+// defaultMIME is the MIME type served when content negotiation fails to
+// match a more specific registered renderer.
+const defaultMIME = "text/html"
+
 // handler represents a http.Handler that renders package documentation.
 type handler struct {
 	mu             sync.Mutex
 	name           string
-	render         func(doc pkgdoc.Package) ([]byte, error)
+	renderers      map[string]func(doc pkgdoc.Package) ([]byte, error)
 	template       string
 	stylesheet     string
 	errorHandler   func(w http.ResponseWriter, req *http.Request, err error)
 	updateDuration time.Duration
 	packages       map[string]*pkg
+	updating       map[string]bool
+	cancels        map[string]context.CancelFunc
+	maxPackages    int
+	maxBytes       int64
+	totalBytes     int64
+	lru            *list.List
+	lruElems       map[string]*list.Element
+	stats          *stats
+	debugPrefix    string
+	search         *searchIndex
+	layoutFiles    []namedTemplate
+	blockFiles     []namedTemplate
+	partialFiles   []namedTemplate
+	templates      *template.Template
+	codewalks      map[string]*codewalk
+	codewalkDirs   []string
+	linkHook       func(target, text string) template.HTML
+	identHook      func(sym pkgdoc.Symbol) template.HTML
+	codeHook       func(src, lang string) template.HTML
 }
 
-// pkg represents package documentation.
+// pkg represents package documentation rendered in a single MIME type.
 type pkg struct {
 	buf     []byte
 	modTime time.Time
+	etag    string
 }
 
 func (p pkg) getReadSeeker() io.ReadSeeker {
@@ -50,18 +81,41 @@ func New(name string, opts ...Option) http.Handler {
 		errorHandler:   defaultErrorHandler,
 		updateDuration: time.Hour,
 		packages:       make(map[string]*pkg),
+		updating:       make(map[string]bool),
+		cancels:        make(map[string]context.CancelFunc),
+		lru:            list.New(),
+		lruElems:       make(map[string]*list.Element),
+		codewalks:      make(map[string]*codewalk),
+		renderers: map[string]func(doc pkgdoc.Package) ([]byte, error){
+			"application/json": defaultJSONRenderer,
+			"text/markdown":    defaultMarkdownRenderer,
+		},
 	}
 	for _, option := range opts {
 		option(h)
 	}
-	if h.render == nil {
-		h.render = h.defaultRenderer
+	h.templates = buildTemplateSet(h)
+	scanCodewalkDirs(h)
+	if _, ok := h.renderers[defaultMIME]; !ok {
+		h.renderers[defaultMIME] = h.defaultRenderer
 	}
 	return h
 }
 
 // ServeHTTP implements the http.Handler interface.
 func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h.search != nil && req.URL.Path == "/search" {
+		h.serveSearch(w, req)
+		return
+	}
+	if len(h.codewalks) > 0 && strings.HasPrefix(req.URL.Path, codewalkPrefix) {
+		h.serveCodewalk(w, req)
+		return
+	}
+	if h.debugPrefix != "" && strings.HasPrefix(req.URL.Path, h.debugPrefix) {
+		h.serveDebug(w, req)
+		return
+	}
 	url := req.URL.Path
 	if !strings.HasPrefix(url, "/") {
 		url = "/" + url
@@ -80,31 +134,103 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if url != "/" {
 		name += path.Clean(url)
 	}
-	buf, modTime, err := h.prepare(name)
+	format := h.negotiate(req.Header.Get("Accept"))
+	p, err := h.prepare(name, format)
 	if err != nil {
 		h.errorHandler(w, req, err)
 		return
 	}
-	http.ServeContent(w, req, name, modTime, buf)
+	w.Header().Set("Content-Type", format)
+	w.Header().Set("ETag", p.etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(h.updateDuration/time.Second)))
+	http.ServeContent(w, req, name, p.modTime, p.getReadSeeker())
+}
+
+// negotiate selects the best registered MIME type for the given Accept
+// header value, preferring higher q-values and falling back to
+// defaultMIME when nothing registered matches.
+func (h *handler) negotiate(accept string) string {
+	if accept == "" {
+		return defaultMIME
+	}
+	type candidate struct {
+		mime string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if fields[0] == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		candidates = append(candidates, candidate{mime: strings.TrimSpace(fields[0]), q: q})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	for _, c := range candidates {
+		if c.mime == "*/*" {
+			return defaultMIME
+		}
+		if _, ok := h.renderers[c.mime]; ok {
+			return c.mime
+		}
+	}
+	return defaultMIME
 }
 
-func (h *handler) prepare(name string) (io.ReadSeeker, time.Time, error) {
+func (h *handler) prepare(name, format string) (*pkg, error) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	p, ok := h.packages[name]
-	if !ok {
-		var err error
-		p, err = h.fetch(name)
-		if err != nil {
-			return nil, time.Time{}, err
+	key := cacheKey(name, format)
+	p, ok := h.packages[key]
+	if ok {
+		if h.stats != nil {
+			h.stats.hit()
 		}
-		go h.update(name)
-		h.packages[name] = p
+		h.touch(name)
+		return p, nil
+	}
+	start := time.Now()
+	p, err := h.fetch(name, format)
+	if h.stats != nil {
+		h.stats.miss(name, time.Since(start), err)
+	}
+	if err != nil {
+		return nil, err
 	}
-	return p.getReadSeeker(), p.modTime, nil
+	h.setPackage(key, p)
+	h.touch(name)
+	h.evict()
+	if !h.updating[name] {
+		h.updating[name] = true
+		ctx, cancel := context.WithCancel(context.Background())
+		h.cancels[name] = cancel
+		go h.update(ctx, name)
+	}
+	return p, nil
 }
 
-func (h *handler) fetch(name string) (*pkg, error) {
+// setPackage stores p under key, keeping h.totalBytes in sync with the
+// cache's actual contents. h.mu must be held.
+func (h *handler) setPackage(key string, p *pkg) {
+	if old, ok := h.packages[key]; ok {
+		h.totalBytes -= int64(len(old.buf))
+	}
+	h.packages[key] = p
+	h.totalBytes += int64(len(p.buf))
+}
+
+func (h *handler) fetch(name, format string) (*pkg, error) {
 	doc, err := pkgdoc.New(name)
 	if doc.Name == "" {
 		err = ErrImport
@@ -112,44 +238,111 @@ func (h *handler) fetch(name string) (*pkg, error) {
 	if err != nil {
 		return nil, err
 	}
-	b, err := h.render(doc)
+	render, ok := h.renderers[format]
+	if !ok {
+		render = h.renderers[defaultMIME]
+	}
+	b, err := render(doc)
 	if err != nil {
 		return nil, err
 	}
-	return &pkg{buf: b, modTime: time.Now()}, nil
+	if h.search != nil {
+		h.search.index(name, doc)
+	}
+	return &pkg{buf: b, modTime: time.Now(), etag: etag(b)}, nil
+}
+
+// etag computes a stable, quoted ETag value from the SHA-256 hash of b.
+func etag(b []byte) string {
+	sum := sha256.Sum256(b)
+	return fmt.Sprintf("%q", hex.EncodeToString(sum[:]))
 }
 
-func (h *handler) update(name string) {
+// update periodically refetches name and re-renders every format cached
+// for it, replacing cache entries whose rendered bytes changed. It
+// returns once ctx is done, which happens when name is evicted from a
+// bounded cache.
+func (h *handler) update(ctx context.Context, name string) {
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case <-time.After(h.updateDuration):
-			p, err := h.fetch(name)
-			if err != nil {
-				continue
-			}
 			h.mu.Lock()
-			if !bytes.Equal(h.packages[name].buf, p.buf) {
-				h.packages[name] = p
+			var formats []string
+			for key := range h.packages {
+				if n, format, ok := splitCacheKey(key); ok && n == name {
+					formats = append(formats, format)
+				}
 			}
 			h.mu.Unlock()
+			for _, format := range formats {
+				p, err := h.fetch(name, format)
+				if err != nil {
+					continue
+				}
+				h.writeBack(ctx, name, format, p)
+			}
 		}
 	}
 }
 
-func (h *handler) defaultRenderer(doc pkgdoc.Package) ([]byte, error) {
-	t, err := template.New("doc").Parse(h.template)
-	if err != nil {
-		return nil, err
+// writeBack stores p in the cache under (name, format) if ctx has not
+// been canceled in the meantime (e.g. by evict, which cancels ctx
+// before removing name's entries) and p's bytes differ from what is
+// already cached. It reports whether it wrote, and must not be called
+// while holding h.mu.
+func (h *handler) writeBack(ctx context.Context, name, format string, p *pkg) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ctx.Err() != nil {
+		return false
 	}
-	var buf bytes.Buffer
+	key := cacheKey(name, format)
+	if cur, ok := h.packages[key]; ok && bytes.Equal(cur.buf, p.buf) {
+		return false
+	}
+	h.setPackage(key, p)
+	return true
+}
+
+// cacheKey and splitCacheKey encode/decode the (format, name) pair used
+// to key h.packages, since a single import path may be cached once per
+// negotiated MIME type.
+func cacheKey(name, format string) string {
+	return format + "\x00" + name
+}
+
+func splitCacheKey(key string) (name, format string, ok bool) {
+	i := strings.IndexByte(key, 0)
+	if i < 0 {
+		return "", "", false
+	}
+	return key[i+1:], key[:i], true
+}
+
+func (h *handler) defaultRenderer(doc pkgdoc.Package) ([]byte, error) {
 	type data struct {
 		pkgdoc.Package
 		StylesheetURL string
 	}
-	err = t.Execute(&buf, data{Package: doc, StylesheetURL: h.stylesheet})
+	d := data{Package: doc, StylesheetURL: h.stylesheet}
+	var buf bytes.Buffer
+	if h.templates != nil {
+		if t := h.templates.Lookup("layout"); t != nil {
+			if err := t.Execute(&buf, d); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}
+	}
+	t, err := template.New("doc").Funcs(h.templateFuncs()).Parse(h.template)
 	if err != nil {
 		return nil, err
 	}
+	if err := t.Execute(&buf, d); err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
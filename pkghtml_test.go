@@ -0,0 +1,74 @@
+package pkghtml
+
+import (
+	"testing"
+
+	"github.com/pnelson/pkgdoc"
+)
+
+func TestNegotiate(t *testing.T) {
+	h := &handler{
+		renderers: map[string]func(doc pkgdoc.Package) ([]byte, error){
+			"text/html":        nil,
+			"application/json": nil,
+			"text/markdown":    nil,
+		},
+	}
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"empty Accept falls back to default", "", defaultMIME},
+		{"exact match", "application/json", "application/json"},
+		{"wildcard falls back to default", "*/*", defaultMIME},
+		{"higher q-value wins", "text/markdown;q=0.1, application/json;q=0.9", "application/json"},
+		{"unregistered type is skipped", "text/plain, text/markdown;q=0.5", "text/markdown"},
+		{"unparseable q-value is treated as 1", "application/json;q=nope", "application/json"},
+		{"nothing registered matches", "text/plain, text/csv", defaultMIME},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.negotiate(tt.accept); got != tt.want {
+				t.Errorf("negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheKeyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name, format string
+	}{
+		{"example.com/foo", "text/html"},
+		{"example.com/foo/bar", "application/json"},
+		{"", "text/markdown"},
+	}
+	for _, tt := range tests {
+		key := cacheKey(tt.name, tt.format)
+		name, format, ok := splitCacheKey(key)
+		if !ok {
+			t.Fatalf("splitCacheKey(%q) reported !ok", key)
+		}
+		if name != tt.name || format != tt.format {
+			t.Errorf("splitCacheKey(cacheKey(%q, %q)) = (%q, %q), want original", tt.name, tt.format, name, format)
+		}
+	}
+}
+
+func TestSplitCacheKeyMalformed(t *testing.T) {
+	if _, _, ok := splitCacheKey("no-separator"); ok {
+		t.Error("splitCacheKey reported ok for a key with no NUL separator")
+	}
+}
+
+func TestEtagDeterministic(t *testing.T) {
+	a := etag([]byte("hello"))
+	b := etag([]byte("hello"))
+	if a != b {
+		t.Errorf("etag is not deterministic: %q != %q", a, b)
+	}
+	if c := etag([]byte("goodbye")); c == a {
+		t.Error("etag collided for distinct input")
+	}
+}
@@ -0,0 +1,50 @@
+package pkghtml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pnelson/pkgdoc"
+)
+
+// defaultJSONRenderer renders doc as indented JSON, registered by
+// default under the "application/json" MIME type.
+func defaultJSONRenderer(doc pkgdoc.Package) ([]byte, error) {
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// defaultMarkdownRenderer renders doc as a Markdown document, mirroring
+// the structure of defaultTemplate without any HTML markup. Registered
+// by default under the "text/markdown" MIME type.
+func defaultMarkdownRenderer(doc pkgdoc.Package) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n\n", doc.Name)
+	fmt.Fprintf(&buf, "    import \"%s\"\n\n", doc.ImportPath)
+	fmt.Fprintf(&buf, "%s\n", doc.Doc.Text)
+	if len(doc.Constants) > 0 {
+		fmt.Fprint(&buf, "\n## Constants\n\n")
+		for _, c := range doc.Constants {
+			fmt.Fprintf(&buf, "```go\n%s\n```\n\n%s\n", c.Decl, c.Doc.Text)
+		}
+	}
+	if len(doc.Variables) > 0 {
+		fmt.Fprint(&buf, "\n## Variables\n\n")
+		for _, v := range doc.Variables {
+			fmt.Fprintf(&buf, "```go\n%s\n```\n\n%s\n", v.Decl, v.Doc.Text)
+		}
+	}
+	for _, fn := range doc.Functions {
+		fmt.Fprintf(&buf, "\n## %s\n\n```go\n%s\n```\n\n%s\n", fn.Name, fn.Decl, fn.Doc.Text)
+	}
+	for _, t := range doc.Types {
+		fmt.Fprintf(&buf, "\n## type %s\n\n```go\n%s\n```\n\n%s\n", t.Name, t.Decl, t.Doc.Text)
+		for _, fn := range t.Functions {
+			fmt.Fprintf(&buf, "\n### %s\n\n```go\n%s\n```\n\n%s\n", fn.Name, fn.Decl, fn.Doc.Text)
+		}
+		for _, m := range t.Methods {
+			fmt.Fprintf(&buf, "\n### %s.%s\n\n```go\n%s\n```\n\n%s\n", t.Name, m.Name, m.Decl, m.Doc.Text)
+		}
+	}
+	return buf.Bytes(), nil
+}
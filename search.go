@@ -0,0 +1,246 @@
+package pkghtml
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pnelson/pkgdoc"
+)
+
+// SearchResult represents a single ranked match returned by a search query.
+type SearchResult struct {
+	Name    string
+	Snippet string
+	Score   int
+}
+
+// searchIndex is an in-memory inverted index over the identifiers,
+// synopses, and doc paragraphs extracted from every package the handler
+// has fetched.
+type searchIndex struct {
+	mu    sync.RWMutex
+	text  map[string]string         // name -> extracted plain text
+	terms map[string]map[string]int // term -> name -> term frequency
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		text:  make(map[string]string),
+		terms: make(map[string]map[string]int),
+	}
+}
+
+// index extracts identifiers, synopses, and doc paragraphs from doc and
+// merges them into the index under name, replacing any previous entry.
+func (idx *searchIndex) index(name string, doc pkgdoc.Package) {
+	text := extractText(doc)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(name)
+	idx.text[name] = text
+	freq := make(map[string]int)
+	for _, term := range tokenize(text) {
+		freq[term]++
+	}
+	for term, n := range freq {
+		m, ok := idx.terms[term]
+		if !ok {
+			m = make(map[string]int)
+			idx.terms[term] = m
+		}
+		m[name] = n
+	}
+}
+
+// remove deletes name from the index. idx.mu must be held for writing.
+func (idx *searchIndex) remove(name string) {
+	delete(idx.text, name)
+	for term, m := range idx.terms {
+		delete(m, name)
+		if len(m) == 0 {
+			delete(idx.terms, term)
+		}
+	}
+}
+
+// search returns ranked results for q, ordered by descending score.
+func (idx *searchIndex) search(q string) []SearchResult {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	scores := make(map[string]int)
+	for _, term := range tokenize(q) {
+		for name, n := range idx.terms[term] {
+			scores[name] += n
+		}
+	}
+	results := make([]SearchResult, 0, len(scores))
+	for name, score := range scores {
+		results = append(results, SearchResult{
+			Name:    name,
+			Snippet: snippet(idx.text[name], q),
+			Score:   score,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// extractText flattens the identifiers, synopsis, and doc paragraphs of
+// doc, including its constants, variables, functions, and types, into a
+// single plain-text blob suitable for tokenizing.
+func extractText(doc pkgdoc.Package) string {
+	var b strings.Builder
+	b.WriteString(doc.Name)
+	b.WriteString(" ")
+	b.WriteString(doc.Synopsis)
+	b.WriteString(" ")
+	b.WriteString(doc.Doc.Text)
+	for _, c := range doc.Constants {
+		b.WriteString(" ")
+		b.WriteString(c.Doc.Text)
+	}
+	for _, v := range doc.Variables {
+		b.WriteString(" ")
+		b.WriteString(v.Doc.Text)
+	}
+	for _, fn := range doc.Functions {
+		b.WriteString(" ")
+		b.WriteString(fn.Name)
+		b.WriteString(" ")
+		b.WriteString(fn.Doc.Text)
+	}
+	for _, t := range doc.Types {
+		b.WriteString(" ")
+		b.WriteString(t.Name)
+		b.WriteString(" ")
+		b.WriteString(t.Doc.Text)
+		for _, c := range t.Constants {
+			b.WriteString(" ")
+			b.WriteString(c.Doc.Text)
+		}
+		for _, v := range t.Variables {
+			b.WriteString(" ")
+			b.WriteString(v.Doc.Text)
+		}
+		for _, fn := range t.Functions {
+			b.WriteString(" ")
+			b.WriteString(fn.Name)
+			b.WriteString(" ")
+			b.WriteString(fn.Doc.Text)
+		}
+		for _, m := range t.Methods {
+			b.WriteString(" ")
+			b.WriteString(m.Name)
+			b.WriteString(" ")
+			b.WriteString(m.Doc.Text)
+		}
+	}
+	return b.String()
+}
+
+// tokenize lowercases s and splits it into a stream of stemmed terms.
+func tokenize(s string) []string {
+	var terms []string
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return false
+		default:
+			return true
+		}
+	}) {
+		if term := stem(strings.ToLower(field)); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// stem applies a small suffix-stripping stemmer so that common
+// inflections, e.g. "handling" and "handled", index under the same term.
+func stem(s string) string {
+	switch {
+	case strings.HasSuffix(s, "ing") && len(s) > 5:
+		return s[:len(s)-3]
+	case strings.HasSuffix(s, "ed") && len(s) > 4:
+		return s[:len(s)-2]
+	case strings.HasSuffix(s, "s") && !strings.HasSuffix(s, "ss") && len(s) > 3:
+		return s[:len(s)-1]
+	}
+	return s
+}
+
+// snippet returns an HTML-escaped excerpt of text around the first match
+// of a term in q, with matches wrapped in <mark> tags.
+func snippet(text, q string) string {
+	const radius = 40
+	lower := strings.ToLower(text)
+	pos := -1
+	for _, term := range tokenize(q) {
+		if i := strings.Index(lower, term); i >= 0 && (pos < 0 || i < pos) {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	start := pos - radius
+	if start < 0 {
+		start = 0
+	}
+	end := pos + radius
+	if end > len(text) {
+		end = len(text)
+	}
+	excerpt := html.EscapeString(strings.TrimSpace(text[start:end]))
+	for _, term := range tokenize(q) {
+		excerpt = highlight(excerpt, term)
+	}
+	return excerpt
+}
+
+// highlight wraps case-insensitive matches of term in s with <mark> tags.
+func highlight(s, term string) string {
+	if term == "" {
+		return s
+	}
+	lower := strings.ToLower(s)
+	var b strings.Builder
+	for i := 0; ; {
+		j := strings.Index(lower[i:], term)
+		if j < 0 {
+			b.WriteString(s[i:])
+			break
+		}
+		j += i
+		b.WriteString(s[i:j])
+		b.WriteString("<mark>")
+		b.WriteString(s[j : j+len(term)])
+		b.WriteString("</mark>")
+		i = j + len(term)
+	}
+	return b.String()
+}
+
+// serveSearch renders ranked results for the "q" query parameter.
+func (h *handler) serveSearch(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query().Get("q")
+	results := h.search.search(q)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>Search: %s</title></head>\n<body>\n", html.EscapeString(q))
+	fmt.Fprintf(w, "<h1>Search results for %s</h1>\n<ul>\n", html.EscapeString(q))
+	for _, r := range results {
+		name := html.EscapeString(r.Name)
+		fmt.Fprintf(w, "<li><a href=\"%s/\">%s</a> &mdash; %s</li>\n", name, name, r.Snippet)
+	}
+	fmt.Fprint(w, "</ul>\n</body>\n</html>")
+}
@@ -0,0 +1,91 @@
+package pkghtml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"splits on punctuation", "Hello, World!", []string{"hello", "world"}},
+		{"stems plurals and verb forms", "handlers handling handled", []string{"handler", "handl", "handl"}},
+		{"keeps underscores", "max_packages", []string{"max_package"}},
+		{"empty input", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenize(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenize(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"handlers", "handler"},
+		{"handling", "handl"},
+		{"handled", "handl"},
+		{"class", "class"}, // "ss" suffix is not stripped
+		{"cat", "cat"},     // too short to strip "s"
+		{"cats", "cat"},
+	}
+	for _, tt := range tests {
+		if got := stem(tt.input); got != tt.want {
+			t.Errorf("stem(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name, s, term, want string
+	}{
+		{"wraps a match", "the cache evicts entries", "cache", "the <mark>cache</mark> evicts entries"},
+		{"is case-insensitive", "the Cache evicts", "cache", "the <mark>Cache</mark> evicts"},
+		{"empty term is a no-op", "the cache", "", "the cache"},
+		{"no match is a no-op", "the cache", "xyz", "the cache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlight(tt.s, tt.term); got != tt.want {
+				t.Errorf("highlight(%q, %q) = %q, want %q", tt.s, tt.term, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippetEscapesHTML(t *testing.T) {
+	got := snippet("a <script>alert(1)</script> handler", "handler")
+	if strings.Contains(got, "<script>") {
+		t.Errorf("snippet did not escape HTML: %q", got)
+	}
+	if !strings.Contains(got, "<mark>handler</mark>") {
+		t.Errorf("snippet did not highlight the matched term: %q", got)
+	}
+}
+
+func TestSearchIndexRemoveIsExclusive(t *testing.T) {
+	idx := newSearchIndex()
+	idx.text["a"] = "alpha"
+	idx.terms["alpha"] = map[string]int{"a": 1, "b": 1}
+
+	idx.remove("a")
+
+	if _, ok := idx.text["a"]; ok {
+		t.Error("remove left a.text entry behind")
+	}
+	if _, ok := idx.terms["alpha"]["a"]; ok {
+		t.Error("remove left a's term entry behind")
+	}
+	if _, ok := idx.terms["alpha"]["b"]; !ok {
+		t.Error("remove deleted an unrelated name's term entry")
+	}
+}